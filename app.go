@@ -1,20 +1,84 @@
 package gapp
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/graceful"
 	"github.com/urfave/negroni"
+	"golang.org/x/net/http2"
 )
 
 // HandlerMapping is used to allow an app to attach its handlers to the Gorilla mux.
 type HandlerMapping struct {
+	// Route is the path pattern registered with the mux.Router, relative to Subrouter if set.
 	Route   string
 	Handler func(rw http.ResponseWriter, r *http.Request)
+
+	// Methods restricts the route to the given HTTP methods. Empty means any method.
+	Methods []string
+	// Middleware is a per-route chain that runs before Handler, layered on top of (i.e. after)
+	// whatever middleware the app configured via SetMiddleware. Use this for things like
+	// requiring auth on a subset of routes without affecting the rest of the app.
+	Middleware []negroni.Handler
+	// Name, if set, names the mux.Route so it can be looked up later via mux.Router.Get(name).
+	Name string
+	// Subrouter groups this mapping under a shared path prefix with any other mapping passed
+	// to RegisterMappings that has the same Subrouter value. Only the prefix is shared: Middleware
+	// is applied to each mapping on its own, and no middleware is attached to the group as a whole.
+	Subrouter string
+}
+
+// RegisterMappings registers each mapping's route, method restriction, and name on r, wrapping
+// Handler with its per-route Middleware chain. Mappings sharing a non-empty Subrouter are
+// grouped under a single r.PathPrefix(subrouter).Subrouter(); each mapping in the group still
+// gets only its own Middleware, with no middleware applied to the subrouter itself.
+func RegisterMappings(r *mux.Router, mappings []HandlerMapping) {
+	subrouters := make(map[string]*mux.Router)
+
+	for _, m := range mappings {
+		target := r
+		if m.Subrouter != "" {
+			sr, ok := subrouters[m.Subrouter]
+			if !ok {
+				sr = r.PathPrefix(m.Subrouter).Subrouter()
+				subrouters[m.Subrouter] = sr
+			}
+			target = sr
+		}
+
+		route := target.HandleFunc(m.Route, wrapHandlerMapping(m))
+		if len(m.Methods) > 0 {
+			route.Methods(m.Methods...)
+		}
+		if m.Name != "" {
+			route.Name(m.Name)
+		}
+	}
+}
+
+// wrapHandlerMapping builds the per-route middleware subchain for a HandlerMapping, falling
+// back to the bare handler when no per-route Middleware is configured.
+func wrapHandlerMapping(m HandlerMapping) http.HandlerFunc {
+	if len(m.Middleware) == 0 {
+		return m.Handler
+	}
+
+	chain := negroni.New(m.Middleware...)
+	chain.UseHandlerFunc(m.Handler)
+
+	return chain.ServeHTTP
 }
 
 // ServerConfig encapsulates the various values needed to start the server
@@ -27,6 +91,127 @@ type ServerConfig struct {
 	TLSPort           int
 	TLSCertFile       string
 	TLSPrivateKeyFile string
+
+	// TLSConfig, when set, is used as the base *tls.Config for the TLS listener. This lets an app
+	// supply its own certificate (e.g. loaded from memory or a secrets manager), cipher suites,
+	// client auth policy, or GetCertificate/SNI callback. TLSCertFile/TLSPrivateKeyFile are only
+	// loaded when TLSConfig is nil or has neither Certificates nor GetCertificate set, and may be
+	// left empty otherwise.
+	TLSConfig *tls.Config
+
+	// HTTP2Enabled controls whether the TLS listener is configured for HTTP/2 via
+	// http2.ConfigureServer, which adds "h2" to the TLS config's NextProtos. A nil value (the
+	// default) is treated as true. Set to a pointer to false to force HTTP/1.1 only (unless a
+	// supplied TLSConfig already lists "h2" in NextProtos).
+	HTTP2Enabled *bool
+
+	// HTTP2Config carries optional HTTP/2-specific tuning (e.g. MaxConcurrentStreams) passed to
+	// http2.ConfigureServer. Nil uses http2's defaults.
+	HTTP2Config *http2.Server
+
+	// DisableSignalHandling opts the app out of gapp's default SIGINT/SIGTERM handling, so
+	// embedders (tests, supervisors that manage their own signal wiring) can drive shutdown
+	// entirely through Stop() instead.
+	DisableSignalHandling bool
+
+	// Network is the network type passed to ListenerFunc, e.g. "tcp" or "unix". Defaults to "tcp".
+	Network string
+
+	// ListenerFunc builds the net.Listener Run serves HTTP (non-TLS) traffic on, in place of the
+	// network/addr it would otherwise derive from Network/Host/Port. Defaults to net.Listen. Use
+	// UnixListener or ActivatedListener to bind a Unix domain socket or adopt a
+	// systemd/einhorn-style socket-activation fd, or supply an httptest-friendly listener for
+	// integration tests.
+	ListenerFunc func(network, addr string) (net.Listener, error)
+
+	// TLSListenerFunc builds the net.Listener Run serves TLS traffic on, analogous to
+	// ListenerFunc. Defaults to ListenerFunc when nil (and to net.Listen when both are nil).
+	// Give this its own hook, distinct from ListenerFunc, when running HTTP and TLS together
+	// with a hook like UnixListener or ActivatedListener that binds a single specific socket —
+	// reusing the same hook for both ports would hand out the same socket twice.
+	TLSListenerFunc func(network, addr string) (net.Listener, error)
+}
+
+// http2Enabled reports the effective value of HTTP2Enabled, defaulting to true when unset.
+func (cfg ServerConfig) http2Enabled() bool {
+	return cfg.HTTP2Enabled == nil || *cfg.HTTP2Enabled
+}
+
+// listen opens the net.Listener for port using listenFunc (defaulting to net.Listen) and
+// Network (defaulting to "tcp").
+func (cfg ServerConfig) listen(port int, listenFunc func(network, addr string) (net.Listener, error)) (net.Listener, error) {
+	if listenFunc == nil {
+		listenFunc = net.Listen
+	}
+
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	return listenFunc(network, cfg.Host+":"+strconv.Itoa(port))
+}
+
+// tlsListenerFunc returns TLSListenerFunc, falling back to ListenerFunc when it's nil so that
+// single-scheme apps (TLS only, or HTTP and TLS both left at the net.Listen default) don't need
+// to set both fields.
+func (cfg ServerConfig) tlsListenerFunc() func(network, addr string) (net.Listener, error) {
+	if cfg.TLSListenerFunc != nil {
+		return cfg.TLSListenerFunc
+	}
+	return cfg.ListenerFunc
+}
+
+// UnixListener returns a ListenerFunc (for ServerConfig.ListenerFunc) that ignores the
+// network/addr it's called with and instead binds a Unix domain socket at path with the given
+// file mode, removing any stale socket left behind by a previous run first.
+func UnixListener(path string, mode os.FileMode) func(network, addr string) (net.Listener, error) {
+	return func(_, _ string) (net.Listener, error) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+
+		return l, nil
+	}
+}
+
+// ActivatedListener returns a ListenerFunc (for ServerConfig.ListenerFunc) that ignores the
+// network/addr it's called with and instead adopts the idx'th socket (0-based) passed down by
+// a systemd/einhorn-style socket activation parent via the LISTEN_FDS/LISTEN_PID environment
+// variables. This lets an app bind privileged ports without running as root, or hand a warm
+// listener across a restart.
+func ActivatedListener(idx int) func(network, addr string) (net.Listener, error) {
+	return func(_, _ string) (net.Listener, error) {
+		pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+		if err != nil || pid != os.Getpid() {
+			return nil, fmt.Errorf("gapp: LISTEN_PID not set for this process; no sockets were activated")
+		}
+
+		fdCount, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil {
+			return nil, fmt.Errorf("gapp: LISTEN_FDS not set; no sockets were activated")
+		}
+
+		if idx < 0 || idx >= fdCount {
+			return nil, fmt.Errorf("gapp: activated socket index %d out of range (LISTEN_FDS=%d)", idx, fdCount)
+		}
+
+		const fdStart = 3 // fds 0-2 are stdin/stdout/stderr; systemd hands activated sockets starting at 3
+		file := os.NewFile(uintptr(fdStart+idx), fmt.Sprintf("listen-fd-%d", idx))
+		defer file.Close()
+
+		return net.FileListener(file)
+	}
 }
 
 // Gapp defines the callback interface that a webservice must implement
@@ -45,64 +230,210 @@ type Gapp interface {
 	GetServerConf(conf Config) ServerConfig
 	// HandleStart callback is fired right before the service starts listening
 	HandleStart(host string, port, tlsPort int)
+	// HandleStopping callback is fired once, after a shutdown signal or a call to Stop() is
+	// received but before the listeners stop accepting in-flight requests. Use it to drain
+	// background work that should wind down ahead of the HTTP servers.
+	HandleStopping()
 	// HandleStopped callback is fired after the app has stopped listening. Teardown code should go here.
 	HandleStopped()
 }
 
-// Run runs a Gapp app object, using its callbacks to configure and fire events. Run blocks until the service is stopped.
+// Run runs a Gapp app object, using its callbacks to configure and fire events. Run blocks
+// until the service is stopped (via SIGINT/SIGTERM or a call to Stop), panicking if the app's
+// server config is invalid. See RunContext for a variant that takes a context.Context and
+// returns an error instead of panicking.
 func Run(app Gapp) {
+	if err := RunContext(context.Background(), app); err != nil {
+		panic(err)
+	}
+}
+
+// RunContext behaves like Run, but additionally triggers a graceful shutdown when ctx is
+// canceled, and returns an error rather than panicking if the app's server config is invalid.
+func RunContext(ctx context.Context, app Gapp) error {
 	config, n := initApp(app)
 
 	serverConfig := app.GetServerConf(config)
 	app.HandleStart(serverConfig.Host, serverConfig.Port, serverConfig.TLSPort)
 
 	if serverConfig.Port <= 0 && serverConfig.TLSPort <= 0 {
-		panic("No ports specified. Must accept at least one scheme (HTTP and/or HTTPS).")
+		return errors.New("no ports specified. Must accept at least one scheme (HTTP and/or HTTPS)")
 	}
 
+	var stopOnce sync.Once
+
+	runMu.Lock()
+	runServers = nil
+	runGracefulTimeout = serverConfig.GracefulTimeout
+	runStopOnce = &stopOnce
+	runHandleStopping = app.HandleStopping
+	runMu.Unlock()
+
 	var wg sync.WaitGroup
 
+	// startedServers tracks servers whose listener goroutine is already running, so a later
+	// setup failure (e.g. the TLS branch below) can stop them before returning the error,
+	// rather than leaving them serving in the background while RunContext (and Run, via panic)
+	// has already unwound.
+	var startedServers []*graceful.Server
+	stopStarted := func() {
+		for _, srv := range startedServers {
+			srv.Stop(serverConfig.GracefulTimeout)
+		}
+		wg.Wait()
+	}
+
 	if serverConfig.Port > 0 {
+		l, err := serverConfig.listen(serverConfig.Port, serverConfig.ListenerFunc)
+		if err != nil {
+			stopStarted()
+			return err
+		}
+
+		srv := &graceful.Server{
+			Timeout:          serverConfig.GracefulTimeout,
+			NoSignalHandling: true,
+
+			Server: &http.Server{
+				Addr:         serverConfig.Host + ":" + strconv.Itoa(serverConfig.Port),
+				Handler:      n,
+				WriteTimeout: serverConfig.WriteTimeout,
+				ReadTimeout:  serverConfig.ReadTimeout,
+			},
+		}
+		registerRunningServer(srv)
+		startedServers = append(startedServers, srv)
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-
-			srv := &graceful.Server{
-				Timeout: serverConfig.GracefulTimeout,
-
-				Server: &http.Server{
-					Addr:         serverConfig.Host + ":" + strconv.Itoa(serverConfig.Port),
-					Handler:      n,
-					WriteTimeout: serverConfig.WriteTimeout,
-					ReadTimeout:  serverConfig.ReadTimeout,
-				},
-			}
-			srv.ListenAndServe()
+			srv.Serve(l)
 		}()
 	}
 
 	if serverConfig.TLSPort > 0 {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
+		l, err := serverConfig.listen(serverConfig.TLSPort, serverConfig.tlsListenerFunc())
+		if err != nil {
+			stopStarted()
+			return err
+		}
+
+		// Clone rather than reuse the caller's *tls.Config directly: Run mutates Certificates
+		// below, and a shared config could be reused elsewhere (another listener, a later
+		// restart).
+		tlsConfig := serverConfig.TLSConfig.Clone()
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+
+		srv := &graceful.Server{
+			Timeout:          serverConfig.GracefulTimeout,
+			NoSignalHandling: true,
 
-			srv := &graceful.Server{
-				Timeout: serverConfig.GracefulTimeout,
+			Server: &http.Server{
+				Addr:         serverConfig.Host + ":" + strconv.Itoa(serverConfig.TLSPort),
+				Handler:      n,
+				WriteTimeout: serverConfig.WriteTimeout,
+				ReadTimeout:  serverConfig.ReadTimeout,
+				TLSConfig:    tlsConfig,
+			},
+		}
+
+		if len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil {
+			cert, err := tls.LoadX509KeyPair(serverConfig.TLSCertFile, serverConfig.TLSPrivateKeyFile)
+			if err != nil {
+				stopStarted()
+				return err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
 
-				Server: &http.Server{
-					Addr:         serverConfig.Host + ":" + strconv.Itoa(serverConfig.TLSPort),
-					Handler:      n,
-					WriteTimeout: serverConfig.WriteTimeout,
-					ReadTimeout:  serverConfig.ReadTimeout,
-				},
+		if serverConfig.http2Enabled() {
+			// ConfigureServer does its own missing-check-and-append of "h2" onto NextProtos, in
+			// place. Clone() above still shares NextProtos' backing array with the caller's
+			// original slice, so copy it first; appending onto it could otherwise, given spare
+			// capacity, silently clobber the caller's own slice.
+			tlsConfig.NextProtos = append([]string(nil), tlsConfig.NextProtos...)
+			if err := http2.ConfigureServer(srv.Server, serverConfig.HTTP2Config); err != nil {
+				stopStarted()
+				return err
 			}
-			srv.ListenAndServeTLS(serverConfig.TLSCertFile, serverConfig.TLSPrivateKeyFile)
+		}
+
+		registerRunningServer(srv)
+		startedServers = append(startedServers, srv)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.Serve(tls.NewListener(l, tlsConfig))
 		}()
 	}
 
+	stopSignals := make(chan os.Signal, 1)
+	if !serverConfig.DisableSignalHandling {
+		signal.Notify(stopSignals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stopSignals)
+	}
+
+	// done lets the watcher goroutine below exit once RunContext returns, even when shutdown
+	// was triggered by a direct Stop() call that never sends on stopSignals or ctx.Done() (the
+	// DisableSignalHandling test-harness pattern). Without it, the goroutine would park forever.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-stopSignals:
+			Stop()
+		case <-ctx.Done():
+			Stop()
+		case <-done:
+		}
+	}()
+
 	wg.Wait()
 
 	app.HandleStopped()
+
+	return nil
+}
+
+var (
+	runMu              sync.Mutex
+	runServers         []*graceful.Server
+	runGracefulTimeout time.Duration
+	runStopOnce        *sync.Once
+	runHandleStopping  func()
+)
+
+// Stop triggers a graceful shutdown of the servers started by the most recent Run/RunContext
+// call, as though a SIGINT/SIGTERM signal had been received. Safe to call from any goroutine,
+// including from within a Gapp callback other than HandleStopping: a Stop call made from
+// inside HandleStopping blocks forever on the sync.Once that runs it. app.HandleStopping is invoked here, before any
+// server's Stop is called, so it always runs ahead of the listeners closing regardless of how
+// the underlying graceful.Server orders its own shutdown hooks.
+func Stop() {
+	runMu.Lock()
+	servers := runServers
+	timeout := runGracefulTimeout
+	once := runStopOnce
+	handleStopping := runHandleStopping
+	runMu.Unlock()
+
+	if once != nil && handleStopping != nil {
+		once.Do(handleStopping)
+	}
+
+	for _, srv := range servers {
+		srv.Stop(timeout)
+	}
+}
+
+func registerRunningServer(srv *graceful.Server) {
+	runMu.Lock()
+	runServers = append(runServers, srv)
+	runMu.Unlock()
 }
 
 var doRunFunc = graceful.Run
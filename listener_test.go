@@ -0,0 +1,47 @@
+package gapp
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestActivatedListenerRequiresMatchingPID(t *testing.T) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+
+	if _, err := ActivatedListener(0)("tcp", ""); err == nil {
+		t.Fatal("expected an error when LISTEN_PID doesn't match the current process")
+	}
+}
+
+func TestActivatedListenerRequiresLISTEN_FDS(t *testing.T) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Unsetenv("LISTEN_FDS")
+
+	if _, err := ActivatedListener(0)("tcp", ""); err == nil {
+		t.Fatal("expected an error when LISTEN_FDS is not set")
+	}
+}
+
+func TestActivatedListenerRejectsOutOfRangeIndex(t *testing.T) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+
+	if _, err := ActivatedListener(1)("tcp", ""); err == nil {
+		t.Fatal("expected an error when idx is out of range for LISTEN_FDS")
+	}
+
+	if _, err := ActivatedListener(-1)("tcp", ""); err == nil {
+		t.Fatal("expected an error when idx is negative")
+	}
+}
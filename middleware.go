@@ -1,15 +1,26 @@
 package gapp
 
 import (
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/urfave/negroni"
 )
 
+// PanicLogger logs a panic recovered by RecoveryMiddleware, so apps can emit structured logs
+// or push to an error tracker without rewriting the recover dance themselves.
+type PanicLogger func(r *http.Request, err interface{}, stack []byte)
+
 type recoveryMiddleware struct {
-	recoverFunc func(rw http.ResponseWriter, r *http.Request)
+	recoverFunc func(rw http.ResponseWriter, r *http.Request, err interface{}, stack []byte)
+	panicLogger PanicLogger
 }
 
 type loggingMiddleware struct {
@@ -19,13 +30,41 @@ type loggingMiddleware struct {
 
 type gzipMiddleware struct{}
 
-// RecoveryMiddleware creates a middleware to handle panics during requests with the supplied func.
-func RecoveryMiddleware(recoverFunc func(rw http.ResponseWriter, r *http.Request)) negroni.Handler {
+type staticMiddleware struct {
+	dir  http.FileSystem
+	opts StaticOptions
+}
+
+// StaticOptions configures StaticMiddleware.
+type StaticOptions struct {
+	// Prefix is stripped from the request path before resolving it against dir.
+	Prefix string
+	// IndexFile is served when a request resolves to a directory. Defaults to "index.html".
+	IndexFile string
+	// SPAFallback, if set, is served instead of falling through to next on a miss, so a
+	// single-page app's client-side router can handle the path.
+	SPAFallback string
+}
+
+// RecoveryMiddleware creates a middleware to handle panics during requests. The middleware
+// always recovers the panic and invokes panicLogger (nil is fine; the panic is still
+// recovered, just not logged). If recoverFunc is nil, a default response is written: a 500
+// with http.StatusText(http.StatusInternalServerError). If recoverFunc is supplied, it's
+// invoked instead with the recovered value and stack trace so the app can write its own
+// response (e.g. a JSON error body).
+func RecoveryMiddleware(recoverFunc func(rw http.ResponseWriter, r *http.Request, err interface{}, stack []byte), panicLogger PanicLogger) negroni.Handler {
 	return &recoveryMiddleware{
 		recoverFunc: recoverFunc,
+		panicLogger: panicLogger,
 	}
 }
 
+// DefaultRecoveryMiddleware creates a RecoveryMiddleware that relies entirely on gapp's built-in
+// panic handling: a 500 response plus a log via panicLogger (nil is fine to skip logging).
+func DefaultRecoveryMiddleware(panicLogger PanicLogger) negroni.Handler {
+	return RecoveryMiddleware(nil, panicLogger)
+}
+
 // LoggingMiddleware creates a middleware to log before and after requests. Nil pre or post funcs are OK.
 // Note: the post-request logging function is not 100% guaranteed to get a valid status. Zero may be supplied if the status is not known.
 func LoggingMiddleware(preLogFunc func(method, path string, start time.Time),
@@ -42,10 +81,42 @@ func GzipMiddleware() negroni.Handler {
 	return &gzipMiddleware{}
 }
 
-func (rec *recoveryMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	if rec.recoverFunc != nil {
-		defer rec.recoverFunc(rw, r)
+// StaticMiddleware creates middleware that serves static assets from dir for GET/HEAD requests,
+// falling through to next on a miss or any other method. Responses get a Content-Type inferred
+// from the file extension, an ETag derived from modtime and size, and support for conditional
+// If-None-Match/If-Modified-Since requests. This composes naturally beneath GzipMiddleware.
+func StaticMiddleware(dir http.FileSystem, opts StaticOptions) negroni.Handler {
+	if opts.IndexFile == "" {
+		opts.IndexFile = "index.html"
+	}
+
+	return &staticMiddleware{
+		dir:  dir,
+		opts: opts,
 	}
+}
+
+func (rec *recoveryMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	defer func() {
+		err := recover()
+		if err == nil {
+			return
+		}
+
+		stack := debug.Stack()
+
+		if rec.panicLogger != nil {
+			rec.panicLogger(r, err, stack)
+		}
+
+		if rec.recoverFunc != nil {
+			rec.recoverFunc(rw, r, err, stack)
+			return
+		}
+
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+	}()
 
 	next(rw, r)
 }
@@ -72,3 +143,90 @@ func (gm *gzipMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, nex
 	zippedHandler := gziphandler.GzipHandler(next)
 	zippedHandler.ServeHTTP(rw, r)
 }
+
+func (sm *staticMiddleware) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next(rw, r)
+		return
+	}
+
+	name, ok := sm.trimPrefix(r.URL.Path)
+	if !ok {
+		next(rw, r)
+		return
+	}
+
+	if sm.serveFile(rw, r, name) {
+		return
+	}
+
+	if sm.opts.SPAFallback != "" && sm.serveFile(rw, r, "/"+strings.TrimPrefix(sm.opts.SPAFallback, "/")) {
+		return
+	}
+
+	next(rw, r)
+}
+
+// trimPrefix strips Prefix from urlPath and reports whether urlPath actually falls under it.
+// A plain strings.TrimPrefix has no path-segment boundary check, so Prefix "/static" would
+// otherwise also match "/staticky/thing" (trimming it to "ky/thing") and serve it out of dir -
+// urlPath must equal Prefix exactly, or continue with a "/", to match.
+func (sm *staticMiddleware) trimPrefix(urlPath string) (string, bool) {
+	if sm.opts.Prefix == "" {
+		return urlPath, true
+	}
+
+	if urlPath == sm.opts.Prefix {
+		return "/", true
+	}
+
+	if strings.HasPrefix(urlPath, sm.opts.Prefix+"/") {
+		return strings.TrimPrefix(urlPath, sm.opts.Prefix), true
+	}
+
+	return "", false
+}
+
+// serveFile attempts to resolve name against dir and write it to rw, returning false on any
+// miss so the caller can fall through to the next candidate (SPAFallback, then next).
+func (sm *staticMiddleware) serveFile(rw http.ResponseWriter, r *http.Request, name string) bool {
+	f, err := sm.dir.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if info.IsDir() {
+		indexName := path.Join(name, sm.opts.IndexFile)
+
+		idx, err := sm.dir.Open(indexName)
+		if err != nil {
+			return false
+		}
+		defer idx.Close()
+
+		idxInfo, err := idx.Stat()
+		if err != nil {
+			return false
+		}
+
+		serveFileContent(rw, r, indexName, idxInfo, idx)
+		return true
+	}
+
+	serveFileContent(rw, r, name, info, f)
+	return true
+}
+
+// serveFileContent sets an ETag derived from modtime and size, then hands off to
+// http.ServeContent, which honors If-None-Match/If-Modified-Since against that ETag and
+// Last-Modified, and infers Content-Type from the file extension.
+func serveFileContent(rw http.ResponseWriter, r *http.Request, name string, info os.FileInfo, content io.ReadSeeker) {
+	rw.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().Unix(), info.Size()))
+	http.ServeContent(rw, r, name, info.ModTime(), content)
+}
@@ -0,0 +1,117 @@
+package gapp
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/urfave/negroni"
+)
+
+// fakeApp is a minimal Gapp used to drive RunContext/Stop in tests, paired with fakeListener
+// so it never binds a fixed port.
+type fakeApp struct {
+	serverConfig ServerConfig
+
+	stoppingCalls int32
+	stopped       chan struct{}
+}
+
+func newFakeApp(cfg ServerConfig) *fakeApp {
+	return &fakeApp{serverConfig: cfg, stopped: make(chan struct{})}
+}
+
+func (a *fakeApp) LoadConfig() Config                          { return Config{} }
+func (a *fakeApp) ConfigureLogging(conf Config)                {}
+func (a *fakeApp) InitResources(conf Config)                   {}
+func (a *fakeApp) ConfigureRoutes(r *mux.Router, conf Config)  {}
+func (a *fakeApp) SetMiddleware(conf Config) []negroni.Handler { return nil }
+func (a *fakeApp) GetServerConf(conf Config) ServerConfig      { return a.serverConfig }
+func (a *fakeApp) HandleStart(host string, port, tlsPort int)  {}
+func (a *fakeApp) HandleStopping()                             { atomic.AddInt32(&a.stoppingCalls, 1) }
+func (a *fakeApp) HandleStopped()                              { close(a.stopped) }
+
+// fakeListener opens a real (but unused) TCP listener on an ephemeral port, so RunContext has
+// something to Serve/Stop without binding to a fixed port that could collide across test runs.
+func fakeListener(t *testing.T) func(network, addr string) (net.Listener, error) {
+	return func(network, addr string) (net.Listener, error) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to open test listener: %v", err)
+		}
+		return l, nil
+	}
+}
+
+func TestStopCallsHandleStoppingOnceAndHandleStopped(t *testing.T) {
+	app := newFakeApp(ServerConfig{
+		Host:                  "127.0.0.1",
+		Port:                  1,
+		DisableSignalHandling: true,
+		ListenerFunc:          fakeListener(t),
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var runErr error
+	go func() {
+		defer wg.Done()
+		runErr = RunContext(context.Background(), app)
+	}()
+
+	// Give RunContext a moment to register its listener before we trigger shutdown.
+	time.Sleep(50 * time.Millisecond)
+
+	Stop()
+	wg.Wait()
+
+	if runErr != nil {
+		t.Fatalf("RunContext returned an error: %v", runErr)
+	}
+	if atomic.LoadInt32(&app.stoppingCalls) != 1 {
+		t.Fatalf("expected HandleStopping to be called exactly once, got %d", app.stoppingCalls)
+	}
+	select {
+	case <-app.stopped:
+	default:
+		t.Fatal("expected HandleStopped to have been called")
+	}
+}
+
+func TestRunContextWatcherGoroutineExitsAfterDirectStop(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	app := newFakeApp(ServerConfig{
+		Host:                  "127.0.0.1",
+		Port:                  1,
+		DisableSignalHandling: true,
+		ListenerFunc:          fakeListener(t),
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunContext(context.Background(), app)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	Stop()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunContext did not return after Stop()")
+	}
+
+	// Give the watcher goroutine a moment to observe the closed done channel and exit.
+	time.Sleep(50 * time.Millisecond)
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("expected no leaked goroutines after RunContext returned, before=%d after=%d", before, after)
+	}
+}
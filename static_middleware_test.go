@@ -0,0 +1,133 @@
+package gapp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mapFileSystem is a minimal http.FileSystem backed by a map from absolute path to content, for
+// exercising staticMiddleware without touching disk.
+type mapFileSystem map[string]string
+
+func (fs mapFileSystem) Open(name string) (http.File, error) {
+	content, ok := fs[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return &memFile{Reader: strings.NewReader(content), info: memFileInfo{name: name, size: int64(len(content))}}, nil
+}
+
+type memFile struct {
+	*strings.Reader
+	info memFileInfo
+}
+
+func (f *memFile) Close() error                             { return nil }
+func (f *memFile) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) { return nil, io.EOF }
+
+type memFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi memFileInfo) ModTime() time.Time { return time.Unix(1700000000, 0) }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+func noopNext(rw http.ResponseWriter, r *http.Request) {
+	rw.WriteHeader(http.StatusNotFound)
+}
+
+func TestStaticMiddlewareServesFile(t *testing.T) {
+	fs := mapFileSystem{"/index.html": "hello"}
+	mw := StaticMiddleware(fs, StaticOptions{Prefix: "/static"})
+
+	req := httptest.NewRequest(http.MethodGet, "/static/index.html", nil)
+	rec := httptest.NewRecorder()
+
+	mw.ServeHTTP(rec, req, noopNext)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "hello" {
+		t.Fatalf("expected body %q, got %q", "hello", rec.Body.String())
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Fatal("expected an ETag header to be set")
+	}
+}
+
+func TestStaticMiddlewarePrefixRequiresSegmentBoundary(t *testing.T) {
+	fs := mapFileSystem{"/ky/thing": "leaked"}
+	mw := StaticMiddleware(fs, StaticOptions{Prefix: "/static"})
+
+	req := httptest.NewRequest(http.MethodGet, "/staticky/thing", nil)
+	rec := httptest.NewRecorder()
+
+	mw.ServeHTTP(rec, req, noopNext)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected the request to fall through to next (404), got %d with body %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStaticMiddlewareConditionalRequest(t *testing.T) {
+	fs := mapFileSystem{"/index.html": "hello"}
+	mw := StaticMiddleware(fs, StaticOptions{Prefix: "/static"})
+
+	req := httptest.NewRequest(http.MethodGet, "/static/index.html", nil)
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, req, noopNext)
+	etag := rec.Header().Get("ETag")
+
+	req2 := httptest.NewRequest(http.MethodGet, "/static/index.html", nil)
+	req2.Header.Set("If-None-Match", etag)
+	rec2 := httptest.NewRecorder()
+	mw.ServeHTTP(rec2, req2, noopNext)
+
+	if rec2.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching If-None-Match, got %d", rec2.Code)
+	}
+}
+
+func TestStaticMiddlewareSPAFallback(t *testing.T) {
+	fs := mapFileSystem{"/index.html": "app shell"}
+	mw := StaticMiddleware(fs, StaticOptions{Prefix: "/static", SPAFallback: "/index.html"})
+
+	req := httptest.NewRequest(http.MethodGet, "/static/some/client/route", nil)
+	rec := httptest.NewRecorder()
+
+	mw.ServeHTTP(rec, req, noopNext)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected SPAFallback to serve 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "app shell" {
+		t.Fatalf("expected fallback body %q, got %q", "app shell", rec.Body.String())
+	}
+}
+
+func TestStaticMiddlewarePassesThroughNonGetMethods(t *testing.T) {
+	fs := mapFileSystem{"/index.html": "hello"}
+	mw := StaticMiddleware(fs, StaticOptions{Prefix: "/static"})
+
+	req := httptest.NewRequest(http.MethodPost, "/static/index.html", nil)
+	rec := httptest.NewRecorder()
+
+	mw.ServeHTTP(rec, req, noopNext)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected POST to fall through to next (404), got %d", rec.Code)
+	}
+}